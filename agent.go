@@ -6,10 +6,8 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net"
 	"strings"
+	"sync"
 
 	vault "github.com/hashicorp/vault/api"
 	"golang.org/x/crypto/ssh"
@@ -25,59 +23,88 @@ var (
 )
 
 type Agent struct {
-	c         *vault.Client
-	mountPath string
-	keyPrefix string
-}
-
-func NewAgent(c *vault.Client, path string) (*Agent, error) {
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) < 1 {
-		return nil, errors.New("invalid secret path")
+	c             *vault.Client
+	sources       []KeySource
+	confirm       ConfirmFunc
+	policy        SignPolicy
+	authenticator Authenticator
+	cache         *signerCache
+
+	mu         sync.Mutex
+	locked     bool
+	passphrase []byte
+	removed    map[string]bool
+	removedAll bool
+
+	certMu      sync.Mutex
+	certSigners map[string]*certSigner
+}
+
+// NewAgent builds an agent that aggregates keys from one or more KeySource
+// mounts, deduplicating by public key when the same key is reachable
+// through more than one source.
+func NewAgent(c *vault.Client, sources ...KeySource) (*Agent, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("at least one key source is required")
 	}
 
 	return &Agent{
-		c:         c,
-		mountPath: parts[0],
-		keyPrefix: strings.Join(parts[1:], "/"),
+		c:       c,
+		sources: sources,
+		removed: map[string]bool{},
+		cache:   newSignerCache(defaultCacheTTL),
 	}, nil
 }
 
-func (a *Agent) ServeConn(c net.Conn) error {
-	defer c.Close()
-	if err := agent.ServeAgent(a, c); err != io.EOF {
-		log.Println("Agent handle connection failed:", err)
-		return err
+// SetAuthenticator lets the agent re-authenticate itself against Vault when
+// a request comes back with a permission-denied error, rather than simply
+// failing once the initial token's renewer gives up.
+func (a *Agent) SetAuthenticator(auth Authenticator) {
+	a.authenticator = auth
+}
+
+func (a *Agent) reauthenticate() error {
+	if a.authenticator == nil {
+		return errors.New("no authenticator configured")
 	}
-	return nil
+	return authenticate(context.Background(), a.c, a.authenticator)
 }
 
 func (a *Agent) List() ([]*agent.Key, error) {
+	if a.isLocked() {
+		// PROTOCOL.agent §2.7: a locked agent reports an empty identity
+		// list, not an error.
+		return nil, nil
+	}
 	signers, err := a.getSigners(false)
 	if err != nil {
 		return nil, err
 	}
 	ret := []*agent.Key{}
 	for _, s := range signers {
-		pk := s.PublicKey()
+		pk := s.signer.PublicKey()
 		ret = append(ret, &agent.Key{
-			Format: pk.Type(),
-			Blob:   pk.Marshal(),
+			Format:  pk.Type(),
+			Blob:    pk.Marshal(),
+			Comment: s.comment,
 		})
 	}
 	return ret, nil
 }
 
 func (a *Agent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	if a.isLocked() {
+		return nil, ErrLocked
+	}
 	signers, err := a.getSigners(false)
 	if err != nil {
 		return nil, err
 	}
 	for _, s := range signers {
-		if !bytes.Equal(s.PublicKey().Marshal(), key.Marshal()) {
+		if !bytes.Equal(s.signer.PublicKey().Marshal(), key.Marshal()) {
 			continue
 		}
-		return s.Sign(rand.Reader, data)
+		return s.signer.Sign(rand.Reader, data)
 	}
 
 	return nil, fmt.Errorf("no private key match requested public key")
@@ -87,71 +114,49 @@ func (a *Agent) Add(key agent.AddedKey) error {
 	return ErrOperationUnsupported
 }
 
-func (a *Agent) Remove(key ssh.PublicKey) error {
-	return ErrOperationUnsupported
-}
-
-func (a *Agent) RemoveAll() error {
-	return ErrOperationUnsupported
-}
-
-func (a *Agent) Lock(passphrase []byte) error {
-	return ErrOperationUnsupported
-}
-
-func (a *Agent) Unlock(passphrase []byte) error {
-	return ErrOperationUnsupported
-}
-
 func (a *Agent) Signers() ([]ssh.Signer, error) {
-	return a.getSigners(true)
-}
-
-func (a *Agent) getSigners(forSign bool) ([]ssh.Signer, error) {
-	path := a.keyListPath()
-	secret, err := a.c.Logical().List(path)
+	if a.isLocked() {
+		return nil, ErrLocked
+	}
+	signers, err := a.getSigners(true)
 	if err != nil {
 		return nil, err
 	}
-	items, ok := secret.Data["keys"].([]interface{})
-	if !ok {
-		return nil, errors.New("unable to get logical list")
+	ret := make([]ssh.Signer, len(signers))
+	for i, s := range signers {
+		ret[i] = s.signer
 	}
-
-	ret := []ssh.Signer{}
-	for _, key := range items {
-		keyStr, ok := key.(string)
-		if !ok {
-			continue
-		}
-		aKey, keyForSign, err := a.getSSHKey(keyStr)
-		if err != nil {
-			log.Printf("Unable to get ssh key name `%s`:%v\n", keyStr, err)
-			continue
-		}
-		if keyForSign == forSign {
-			ret = append(ret, aKey)
-		}
-	}
-
 	return ret, nil
 }
 
-func (a *Agent) kv2() *vault.KVv2 {
-	return a.c.KVv2(a.mountPath)
-}
+var errNoKeyList = errors.New("unable to get logical list")
 
-func (a *Agent) keyListPath() string {
-	return strings.Join([]string{a.mountPath, "metadata", a.keyPrefix}, "/")
-}
+// getSigners reads from the signer cache, only hitting Vault on a cache
+// miss (nothing loaded yet, or the cache was invalidated).
+func (a *Agent) getSigners(forSign bool) ([]cachedSigner, error) {
+	signers, ok := a.cache.get(forSign)
+	if !ok {
+		if err := a.Refresh(context.Background()); err != nil {
+			return nil, err
+		}
+		signers, _ = a.cache.get(forSign)
+	}
 
-func (a *Agent) keyPath(name string) string {
-	return strings.Join([]string{a.keyPrefix, name}, "/")
+	ret := []cachedSigner{}
+	for _, s := range signers {
+		if !a.isRemoved(s.signer.PublicKey()) {
+			ret = append(ret, s)
+		}
+	}
+	return ret, nil
 }
 
-func (a *Agent) getSSHKey(name string) (ssh.Signer, bool, error) {
+func (a *Agent) getSSHKey(src KeySource, name string) (ssh.Signer, bool, error) {
 	ctx := context.Background()
-	secret, err := a.kv2().Get(ctx, a.keyPath(name))
+	secret, err := a.c.KVv2(src.Mount).Get(ctx, name)
+	if isPermissionDenied(err) && a.reauthenticate() == nil {
+		secret, err = a.c.KVv2(src.Mount).Get(ctx, name)
+	}
 	if err != nil {
 		return nil, false, err
 	}
@@ -164,6 +169,14 @@ func (a *Agent) getSSHKey(name string) (ssh.Signer, bool, error) {
 		return nil, false, err
 	}
 
+	var signer ssh.Signer = privateKey
+	if ca, ok := parseSSHCA(secret.Data); ok {
+		signer = a.certSignerFor(src, name, privateKey, ca)
+	}
+	if confirm, ok := secret.Data["confirm"].(bool); ok && confirm {
+		signer = &confirmingSigner{Signer: signer, a: a, name: name}
+	}
+
 	forSign := false
 	forSignData, forSignOk := secret.Data["sign"].(string)
 	if forSignOk {
@@ -171,5 +184,37 @@ func (a *Agent) getSSHKey(name string) (ssh.Signer, bool, error) {
 		forSign = !negativeForSign[forSignData]
 	}
 
-	return privateKey, forSign, nil
+	return signer, forSign, nil
+}
+
+// parseSSHCA extracts the Vault SSH secrets engine signing parameters from a
+// KV v2 secret, if present. A secret only opts into certificate signing by
+// setting both `ca_mount` and `role`.
+func parseSSHCA(data map[string]interface{}) (sshCA, bool) {
+	mount, ok := data["ca_mount"].(string)
+	if !ok || mount == "" {
+		return sshCA{}, false
+	}
+	role, ok := data["role"].(string)
+	if !ok || role == "" {
+		return sshCA{}, false
+	}
+
+	ca := sshCA{mount: mount, role: role}
+	if ttl, ok := data["ttl"].(string); ok {
+		ca.ttl = ttl
+	}
+	if principals, ok := data["principals"].(string); ok && principals != "" {
+		ca.principals = strings.Split(principals, ",")
+	}
+	if extensions, ok := data["extensions"].(map[string]interface{}); ok {
+		ca.extensions = make(map[string]string, len(extensions))
+		for k, v := range extensions {
+			if s, ok := v.(string); ok {
+				ca.extensions[k] = s
+			}
+		}
+	}
+
+	return ca, true
 }
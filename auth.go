@@ -0,0 +1,154 @@
+package vaultagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// Authenticator knows how to log in to Vault and returns the resulting
+// auth secret, which carries the client token plus renewal metadata.
+type Authenticator interface {
+	Login(ctx context.Context, c *vault.Client) (*vault.Secret, error)
+}
+
+// TokenAuth authenticates with an already-issued Vault token. It is used
+// both directly and as the building block for FileTokenAuth.
+type TokenAuth struct {
+	Token string
+}
+
+func (a TokenAuth) Login(ctx context.Context, c *vault.Client) (*vault.Secret, error) {
+	c.SetToken(a.Token)
+	secret, err := c.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up vault token: %w", err)
+	}
+	if secret.Auth == nil {
+		// lookup-self reports lease info under Data rather than Auth, since
+		// it isn't itself a login response. Surface it the same way a real
+		// login would so the LifetimeWatcher in watchLifetime can renew it.
+		renewable, _ := secret.Data["renewable"].(bool)
+		secret.Auth = &vault.SecretAuth{
+			ClientToken:   a.Token,
+			Renewable:     renewable,
+			LeaseDuration: ttlFromData(secret.Data, "ttl"),
+		}
+	}
+	return secret, nil
+}
+
+// ttlFromData reads a TTL-in-seconds field out of a Vault response's Data
+// map, which decodes as json.Number, float64 or a numeric string
+// depending on the endpoint.
+func ttlFromData(data map[string]interface{}, key string) int {
+	switch v := data[key].(type) {
+	case json.Number:
+		n, _ := v.Int64()
+		return int(n)
+	case float64:
+		return int(v)
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			return int(d.Seconds())
+		}
+	}
+	return 0
+}
+
+// FileTokenAuth reads a Vault token from a file on disk, e.g. the default
+// ~/.vault-token written by `vault login`.
+type FileTokenAuth struct {
+	Path string
+}
+
+func (a FileTokenAuth) Login(ctx context.Context, c *vault.Client) (*vault.Secret, error) {
+	data, err := os.ReadFile(a.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vault token file `%s`: %w", a.Path, err)
+	}
+	return TokenAuth{Token: strings.TrimSpace(string(data))}.Login(ctx, c)
+}
+
+// AppRoleAuth authenticates against the AppRole auth method.
+type AppRoleAuth struct {
+	MountPath string // defaults to "approle"
+	RoleID    string
+	SecretID  string
+}
+
+func (a AppRoleAuth) Login(ctx context.Context, c *vault.Client) (*vault.Secret, error) {
+	mount := a.MountPath
+	if mount == "" {
+		mount = "approle"
+	}
+	return c.Logical().WriteWithContext(ctx, mount+"/login", map[string]interface{}{
+		"role_id":   a.RoleID,
+		"secret_id": a.SecretID,
+	})
+}
+
+// KubernetesAuth authenticates using the projected service account JWT
+// against the Kubernetes auth method.
+type KubernetesAuth struct {
+	MountPath string // defaults to "kubernetes"
+	Role      string
+	JWTPath   string // defaults to the default service account token path
+}
+
+func (a KubernetesAuth) Login(ctx context.Context, c *vault.Client) (*vault.Secret, error) {
+	mount := a.MountPath
+	if mount == "" {
+		mount = "kubernetes"
+	}
+	jwtPath := a.JWTPath
+	if jwtPath == "" {
+		jwtPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	}
+	jwt, err := os.ReadFile(jwtPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account token `%s`: %w", jwtPath, err)
+	}
+	return c.Logical().WriteWithContext(ctx, mount+"/login", map[string]interface{}{
+		"role": a.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+}
+
+// OIDCAuth authenticates against the JWT/OIDC auth method using a static
+// JWT, e.g. one minted by a workload identity provider. Interactive
+// browser-based OIDC login is out of scope for a headless agent.
+type OIDCAuth struct {
+	MountPath string // defaults to "oidc"
+	Role      string
+	JWT       string
+	JWTPath   string // read from disk instead of JWT when set
+}
+
+func (a OIDCAuth) Login(ctx context.Context, c *vault.Client) (*vault.Secret, error) {
+	mount := a.MountPath
+	if mount == "" {
+		mount = "oidc"
+	}
+	jwt := a.JWT
+	if a.JWTPath != "" {
+		data, err := os.ReadFile(a.JWTPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read jwt file `%s`: %w", a.JWTPath, err)
+		}
+		jwt = strings.TrimSpace(string(data))
+	}
+	return c.Logical().WriteWithContext(ctx, mount+"/login", map[string]interface{}{
+		"role": a.Role,
+		"jwt":  jwt,
+	})
+}
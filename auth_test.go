@@ -0,0 +1,46 @@
+package vaultagent
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestTTLFromData(t *testing.T) {
+	cases := []struct {
+		name string
+		data map[string]interface{}
+		want int
+	}{
+		{name: "json.Number", data: map[string]interface{}{"ttl": json.Number("3600")}, want: 3600},
+		{name: "float64", data: map[string]interface{}{"ttl": float64(1800)}, want: 1800},
+		{name: "numeric string", data: map[string]interface{}{"ttl": "900"}, want: 900},
+		{name: "duration string", data: map[string]interface{}{"ttl": "1h"}, want: 3600},
+		{name: "missing key", data: map[string]interface{}{}, want: 0},
+		{name: "wrong type", data: map[string]interface{}{"ttl": true}, want: 0},
+		{name: "unparseable string", data: map[string]interface{}{"ttl": "not-a-duration"}, want: 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ttlFromData(tc.data, "ttl"); got != tc.want {
+				t.Fatalf("ttlFromData(%+v, \"ttl\") = %d, want %d", tc.data, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFileTokenAuthMissingFile(t *testing.T) {
+	a := FileTokenAuth{Path: filepath.Join(t.TempDir(), "does-not-exist")}
+	if _, err := a.Login(context.Background(), nil); err == nil {
+		t.Fatal("Login with a missing token file should return an error")
+	}
+}
+
+func TestKubernetesAuthMissingJWTFile(t *testing.T) {
+	a := KubernetesAuth{Role: "default", JWTPath: filepath.Join(t.TempDir(), "does-not-exist")}
+	if _, err := a.Login(context.Background(), nil); err == nil {
+		t.Fatal("Login with a missing service account token file should return an error")
+	}
+}
@@ -0,0 +1,300 @@
+package vaultagent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultCacheTTL = time.Minute
+
+// CacheMetrics are Prometheus-style counters a caller can scrape into its
+// own registry; vault-agent does not depend on a metrics library itself.
+type CacheMetrics struct {
+	Hits   uint64
+	Misses uint64
+	Errors uint64
+}
+
+type cachedSigner struct {
+	signer  ssh.Signer
+	forSign bool
+	comment string
+}
+
+// knownEntry remembers the KV v2 metadata updated_time Refresh last saw for
+// one entry, alongside the signer it produced, so a later Refresh can skip
+// re-fetching (and, for cert-backed keys, re-signing) entries Vault hasn't
+// actually changed.
+type knownEntry struct {
+	updatedTime time.Time
+	signer      cachedSigner
+}
+
+// signerCache holds every signer the agent currently knows about, loaded
+// wholesale on startup and refreshed on an interval instead of hitting
+// Vault on every List/Sign.
+type signerCache struct {
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]cachedSigner
+	loaded  bool
+
+	knownMu sync.Mutex
+	known   map[string]knownEntry
+
+	hits, misses, errors uint64
+}
+
+func newSignerCache(ttl time.Duration) *signerCache {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &signerCache{
+		ttl:     ttl,
+		entries: map[string]cachedSigner{},
+		known:   map[string]knownEntry{},
+	}
+}
+
+// knownFor returns the last Refresh's result for key, if any.
+func (c *signerCache) knownFor(key string) (knownEntry, bool) {
+	c.knownMu.Lock()
+	defer c.knownMu.Unlock()
+	e, ok := c.known[key]
+	return e, ok
+}
+
+// remember records Refresh's result for key so the next Refresh can reuse
+// it when the entry is unchanged.
+func (c *signerCache) remember(key string, e knownEntry) {
+	c.knownMu.Lock()
+	defer c.knownMu.Unlock()
+	c.known[key] = e
+}
+
+func (c *signerCache) get(forSign bool) ([]cachedSigner, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.loaded {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+
+	ret := []cachedSigner{}
+	for _, e := range c.entries {
+		if e.forSign == forSign {
+			ret = append(ret, e)
+		}
+	}
+	return ret, true
+}
+
+func (c *signerCache) set(entries map[string]cachedSigner) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = entries
+	c.loaded = true
+}
+
+// invalidate forgets the known state for every entry named name (across
+// whichever sources it appears under) and forces one reload. The served
+// snapshot is still keyed by public-key fingerprint rather than Vault path
+// (multiple sources can alias the same key), so that snapshot itself is
+// reloaded wholesale on the next getSigners call; forgetting the matching
+// "known" entries first is what makes that reload skip every other,
+// unaffected entry instead of re-fetching everything.
+func (c *signerCache) invalidate(name string) {
+	suffix := "\x00" + name
+	c.knownMu.Lock()
+	for key := range c.known {
+		if strings.HasSuffix(key, suffix) {
+			delete(c.known, key)
+		}
+	}
+	c.knownMu.Unlock()
+	c.invalidateAll()
+}
+
+func (c *signerCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loaded = false
+}
+
+func (c *signerCache) recordError() {
+	atomic.AddUint64(&c.errors, 1)
+}
+
+func (c *signerCache) metrics() CacheMetrics {
+	return CacheMetrics{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Errors: atomic.LoadUint64(&c.errors),
+	}
+}
+
+// SetCacheTTL configures how long a loaded cache is trusted before
+// WatchCache refreshes it. It has no effect once WatchCache is running;
+// call it before starting the agent's serve loop.
+func (a *Agent) SetCacheTTL(ttl time.Duration) {
+	a.cache.ttl = ttl
+}
+
+// CacheMetrics reports cache hit/miss/error counters for scraping into a
+// Prometheus registry.
+func (a *Agent) CacheMetrics() CacheMetrics {
+	return a.cache.metrics()
+}
+
+// EventSubscriber lets an agent invalidate individual cache entries as
+// soon as Vault reports a change, instead of waiting for the next poll.
+// A caller backed by Vault's event notification system (e.g.
+// sys/events/subscribe/kv-v2/*) can implement this and hand it to
+// SetEventSource; without one, WatchCache's polling interval is the only
+// way entries get refreshed.
+type EventSubscriber interface {
+	Subscribe(ctx context.Context, onKeyChanged func(name string)) error
+}
+
+// SetEventSource installs sub as the agent's cache invalidation source and
+// starts it against ctx. Subscribe is expected to block until ctx is done.
+func (a *Agent) SetEventSource(ctx context.Context, sub EventSubscriber) {
+	go func() {
+		if err := sub.Subscribe(ctx, a.cache.invalidate); err != nil {
+			log.Println("Vault event subscription ended:", err)
+		}
+	}()
+}
+
+// Refresh reloads every signer from every configured KeySource and
+// replaces the cache wholesale, deduplicating by public-key fingerprint so
+// the same key reachable through two sources only shows up once. Entries
+// whose KV v2 metadata reports the same updated_time as the previous
+// Refresh are served from the known-entry cache instead of being re-fetched,
+// so an unrelated change elsewhere in a source (or a plain TTL tick) does
+// not force every cert-backed key to be re-signed.
+//
+// A transient failure on one entry falls back to whatever that entry last
+// resolved to successfully, so one flaky key doesn't disappear from the
+// served list. If nothing could be refreshed at all, Refresh returns an
+// error and leaves the previously served snapshot (if any) in place
+// instead of replacing it with an empty one.
+func (a *Agent) Refresh(ctx context.Context) error {
+	entries := map[string]cachedSigner{}
+	sawError := false
+
+	for _, src := range a.sources {
+		names, err := a.walk(ctx, src)
+		if err != nil {
+			log.Printf("Unable to list key source `%s`: %v\n", src.Mount, err)
+			a.cache.recordError()
+			sawError = true
+			continue
+		}
+		for _, name := range names {
+			signer, forSign, comment, err := a.refreshEntry(ctx, src, name)
+			if err != nil {
+				log.Printf("Unable to get ssh key `%s/%s`: %v\n", src.Mount, name, err)
+				a.cache.recordError()
+				sawError = true
+
+				if known, ok := a.cache.knownFor(entryKey(src, name)); ok {
+					signer, forSign, comment = known.signer.signer, known.signer.forSign, known.signer.comment
+				} else {
+					continue
+				}
+			}
+
+			fingerprint := string(signer.PublicKey().Marshal())
+			if _, exists := entries[fingerprint]; exists {
+				continue
+			}
+			entries[fingerprint] = cachedSigner{
+				signer:  signer,
+				forSign: forSign,
+				comment: comment,
+			}
+		}
+	}
+
+	if len(entries) == 0 && sawError {
+		return fmt.Errorf("unable to refresh any key source")
+	}
+
+	a.cache.set(entries)
+	return nil
+}
+
+// refreshEntry fetches one key, unless its KV v2 metadata updated_time
+// matches what the previous Refresh saw, in which case the remembered
+// signer is reused as-is.
+func (a *Agent) refreshEntry(ctx context.Context, src KeySource, name string) (ssh.Signer, bool, string, error) {
+	key := entryKey(src, name)
+
+	if updatedTime, err := a.getKVUpdatedTime(ctx, src, name); err == nil {
+		if known, ok := a.cache.knownFor(key); ok && known.updatedTime.Equal(updatedTime) {
+			return known.signer.signer, known.signer.forSign, known.signer.comment, nil
+		}
+
+		signer, forSign, err := a.getSSHKey(src, name)
+		if err != nil {
+			return nil, false, "", err
+		}
+		comment := src.comment(name)
+		a.cache.remember(key, knownEntry{
+			updatedTime: updatedTime,
+			signer:      cachedSigner{signer: signer, forSign: forSign, comment: comment},
+		})
+		return signer, forSign, comment, nil
+	}
+
+	signer, forSign, err := a.getSSHKey(src, name)
+	if err != nil {
+		return nil, false, "", err
+	}
+	return signer, forSign, src.comment(name), nil
+}
+
+// getKVUpdatedTime reads the current updated_time for name out of its KV v2
+// metadata, which is far cheaper than fetching (and, for cert-backed keys,
+// potentially re-signing) the entry itself.
+func (a *Agent) getKVUpdatedTime(ctx context.Context, src KeySource, name string) (time.Time, error) {
+	meta, err := a.c.KVv2(src.Mount).GetMetadata(ctx, name)
+	if isPermissionDenied(err) && a.reauthenticate() == nil {
+		meta, err = a.c.KVv2(src.Mount).GetMetadata(ctx, name)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return meta.UpdatedTime, nil
+}
+
+// WatchCache loads the cache immediately, then refreshes it on the
+// configured TTL until ctx is done.
+func (a *Agent) WatchCache(ctx context.Context) {
+	if err := a.Refresh(ctx); err != nil {
+		log.Println("Initial vault cache load failed:", err)
+	}
+
+	ticker := time.NewTicker(a.cache.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.Refresh(ctx); err != nil {
+				log.Println("Vault cache refresh failed:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package vaultagent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignerCacheGetSet(t *testing.T) {
+	c := newSignerCache(time.Minute)
+
+	if _, ok := c.get(false); ok {
+		t.Fatal("get on an unloaded cache should report a miss")
+	}
+
+	c.set(map[string]cachedSigner{
+		"fp1": {forSign: false, comment: "one"},
+		"fp2": {forSign: true, comment: "two"},
+	})
+
+	signers, ok := c.get(false)
+	if !ok || len(signers) != 1 || signers[0].comment != "one" {
+		t.Fatalf("get(false) = %+v, %v; want one forSign=false entry", signers, ok)
+	}
+	signers, ok = c.get(true)
+	if !ok || len(signers) != 1 || signers[0].comment != "two" {
+		t.Fatalf("get(true) = %+v, %v; want one forSign=true entry", signers, ok)
+	}
+}
+
+func TestSignerCacheInvalidateTargeted(t *testing.T) {
+	c := newSignerCache(time.Minute)
+	c.set(map[string]cachedSigner{"fp1": {comment: "one"}})
+
+	aliceKey := entryKey(KeySource{Mount: "kv"}, "alice")
+	bobKey := entryKey(KeySource{Mount: "kv"}, "bob")
+	c.remember(aliceKey, knownEntry{updatedTime: time.Unix(1, 0)})
+	c.remember(bobKey, knownEntry{updatedTime: time.Unix(2, 0)})
+
+	c.invalidate("alice")
+
+	if _, ok := c.knownFor(aliceKey); ok {
+		t.Fatal("invalidate(\"alice\") should forget alice's known entry")
+	}
+	if _, ok := c.knownFor(bobKey); !ok {
+		t.Fatal("invalidate(\"alice\") must not forget bob's known entry")
+	}
+	if _, ok := c.get(false); ok {
+		t.Fatal("invalidate should force the served snapshot to reload")
+	}
+}
+
+func TestSignerCacheKnownEntryRoundTrip(t *testing.T) {
+	c := newSignerCache(time.Minute)
+	key := entryKey(KeySource{Mount: "kv"}, "alice")
+
+	if _, ok := c.knownFor(key); ok {
+		t.Fatal("knownFor should report a miss before remember is called")
+	}
+
+	want := knownEntry{updatedTime: time.Unix(42, 0), signer: cachedSigner{comment: "alice"}}
+	c.remember(key, want)
+
+	got, ok := c.knownFor(key)
+	if !ok || !got.updatedTime.Equal(want.updatedTime) || got.signer.comment != want.signer.comment {
+		t.Fatalf("knownFor(%q) = %+v, %v; want %+v, true", key, got, ok, want)
+	}
+}
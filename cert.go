@@ -0,0 +1,173 @@
+package vaultagent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// certRefreshMargin controls how long before a certificate's expiry the
+// agent considers it stale and re-signs it.
+const certRefreshMargin = 30 * time.Second
+
+// sshCA holds the Vault SSH secrets engine parameters stored alongside a
+// private key that should be presented as a signed certificate instead of
+// the raw key. The agent lists one identity per such secret: the
+// certificate, or the raw public key only while no certificate can be
+// obtained from Vault.
+type sshCA struct {
+	mount      string
+	role       string
+	principals []string
+	ttl        string
+	extensions map[string]string
+}
+
+// certSigner wraps a long-lived private key and lazily asks Vault's SSH
+// secrets engine to sign it into a short-lived certificate, caching the
+// result until it is close to expiry.
+type certSigner struct {
+	a          *Agent
+	name       string
+	privateKey ssh.Signer
+	ca         sshCA
+
+	mu        sync.Mutex
+	signer    ssh.Signer
+	expiresAt time.Time
+}
+
+func newCertSigner(a *Agent, name string, privateKey ssh.Signer, ca sshCA) *certSigner {
+	return &certSigner{
+		a:          a,
+		name:       name,
+		privateKey: privateKey,
+		ca:         ca,
+	}
+}
+
+// certSignerFor returns the certSigner for src/name, reusing the one from
+// the previous Refresh when the underlying private key hasn't changed so
+// its cached certificate survives instead of being re-signed on every
+// cache reload. A rotated private key invalidates the cached certificate,
+// since it was signed for the old key.
+func (a *Agent) certSignerFor(src KeySource, name string, privateKey ssh.Signer, ca sshCA) *certSigner {
+	key := entryKey(src, name)
+
+	a.certMu.Lock()
+	defer a.certMu.Unlock()
+	if a.certSigners == nil {
+		a.certSigners = map[string]*certSigner{}
+	}
+
+	cs, ok := a.certSigners[key]
+	if !ok {
+		cs = newCertSigner(a, name, privateKey, ca)
+		a.certSigners[key] = cs
+		return cs
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if !bytes.Equal(cs.privateKey.PublicKey().Marshal(), privateKey.PublicKey().Marshal()) {
+		cs.signer = nil
+		cs.expiresAt = time.Time{}
+	}
+	cs.privateKey = privateKey
+	cs.ca = ca
+	return cs
+}
+
+func (c *certSigner) PublicKey() ssh.PublicKey {
+	signer, err := c.resolveSigner()
+	if err != nil {
+		return c.privateKey.PublicKey()
+	}
+	return signer.PublicKey()
+}
+
+func (c *certSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	signer, err := c.resolveSigner()
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(rand, data)
+}
+
+// resolveSigner returns the cached cert signer, re-signing via Vault when it is
+// missing or close to expiry.
+func (c *certSigner) resolveSigner() (ssh.Signer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.signer != nil && time.Now().Before(c.expiresAt) {
+		return c.signer, nil
+	}
+
+	signer, expiresAt, err := c.a.signSSHCert(c.name, c.privateKey, c.ca)
+	if err != nil {
+		return nil, err
+	}
+	c.signer = signer
+	c.expiresAt = expiresAt
+	return signer, nil
+}
+
+// signSSHCert asks Vault's ssh/sign endpoint to issue a certificate for
+// privateKey's public key and combines the two into a single ssh.Signer,
+// mirroring how cashier's InstallCert attaches a Certificate to an
+// agent.AddedKey.
+func (a *Agent) signSSHCert(name string, privateKey ssh.Signer, ca sshCA) (ssh.Signer, time.Time, error) {
+	data := map[string]interface{}{
+		"public_key": string(ssh.MarshalAuthorizedKey(privateKey.PublicKey())),
+	}
+	if len(ca.principals) > 0 {
+		data["valid_principals"] = strings.Join(ca.principals, ",")
+	}
+	if ca.ttl != "" {
+		data["ttl"] = ca.ttl
+	}
+	if len(ca.extensions) > 0 {
+		data["extensions"] = ca.extensions
+	}
+
+	path := strings.Join([]string{ca.mount, "sign", ca.role}, "/")
+	secret, err := a.c.Logical().WriteWithContext(context.Background(), path, data)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("unable to sign ssh cert for `%s`: %w", name, err)
+	}
+	if secret == nil {
+		return nil, time.Time{}, fmt.Errorf("empty response signing ssh cert for `%s`", name)
+	}
+	signedKey, ok := secret.Data["signed_key"].(string)
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("no signed_key returned for `%s`", name)
+	}
+
+	pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(signedKey))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("unable to parse signed cert for `%s`: %w", name, err)
+	}
+	cert, ok := pk.(*ssh.Certificate)
+	if !ok {
+		return nil, time.Time{}, fmt.Errorf("signed_key for `%s` is not a certificate", name)
+	}
+
+	signer, err := ssh.NewCertSigner(cert, privateKey)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("unable to build cert signer for `%s`: %w", name, err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		expiresAt = time.Unix(int64(cert.ValidBefore), 0).Add(-certRefreshMargin)
+	}
+
+	return signer, expiresAt, nil
+}
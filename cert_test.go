@@ -0,0 +1,156 @@
+package vaultagent
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	signer, err := ssh.NewSignerFromSigner(priv)
+	if err != nil {
+		t.Fatalf("ssh.NewSignerFromSigner: %v", err)
+	}
+	return signer
+}
+
+func TestCertSignerForReusesInstance(t *testing.T) {
+	a := newTestAgent(t)
+	src := KeySource{Mount: "kv"}
+	privateKey := newTestSigner(t)
+	ca := sshCA{mount: "ssh", role: "default"}
+
+	first := a.certSignerFor(src, "alice", privateKey, ca)
+	first.signer = privateKey
+	first.expiresAt = time.Now().Add(time.Hour)
+
+	second := a.certSignerFor(src, "alice", privateKey, ca)
+	if second != first {
+		t.Fatal("certSignerFor should return the same instance for the same source/name/key")
+	}
+	if second.signer == nil || second.expiresAt.IsZero() {
+		t.Fatal("certSignerFor must preserve the cached cert when the private key is unchanged")
+	}
+}
+
+func TestCertSignerForDistinctEntries(t *testing.T) {
+	a := newTestAgent(t)
+	src := KeySource{Mount: "kv"}
+	privateKey := newTestSigner(t)
+	ca := sshCA{mount: "ssh", role: "default"}
+
+	alice := a.certSignerFor(src, "alice", privateKey, ca)
+	bob := a.certSignerFor(src, "bob", privateKey, ca)
+	if alice == bob {
+		t.Fatal("certSignerFor must not share instances across different names")
+	}
+}
+
+func TestParseSSHCA(t *testing.T) {
+	cases := []struct {
+		name string
+		data map[string]interface{}
+		want sshCA
+		ok   bool
+	}{
+		{
+			name: "missing ca_mount opts out",
+			data: map[string]interface{}{"role": "default"},
+			ok:   false,
+		},
+		{
+			name: "missing role opts out",
+			data: map[string]interface{}{"ca_mount": "ssh"},
+			ok:   false,
+		},
+		{
+			name: "mount and role only",
+			data: map[string]interface{}{"ca_mount": "ssh", "role": "default"},
+			want: sshCA{mount: "ssh", role: "default"},
+			ok:   true,
+		},
+		{
+			name: "ttl and principals",
+			data: map[string]interface{}{
+				"ca_mount":   "ssh",
+				"role":       "default",
+				"ttl":        "1h",
+				"principals": "alice,bob",
+			},
+			want: sshCA{mount: "ssh", role: "default", ttl: "1h", principals: []string{"alice", "bob"}},
+			ok:   true,
+		},
+		{
+			name: "extensions map keeps only string values",
+			data: map[string]interface{}{
+				"ca_mount": "ssh",
+				"role":     "default",
+				"extensions": map[string]interface{}{
+					"permit-pty":      "",
+					"non-string-skip": 123,
+				},
+			},
+			want: sshCA{mount: "ssh", role: "default", extensions: map[string]string{"permit-pty": ""}},
+			ok:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseSSHCA(tc.data)
+			if ok != tc.ok {
+				t.Fatalf("parseSSHCA(%+v) ok = %v, want %v", tc.data, ok, tc.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.mount != tc.want.mount || got.role != tc.want.role || got.ttl != tc.want.ttl {
+				t.Fatalf("parseSSHCA(%+v) = %+v, want %+v", tc.data, got, tc.want)
+			}
+			if len(got.principals) != len(tc.want.principals) {
+				t.Fatalf("parseSSHCA(%+v) principals = %v, want %v", tc.data, got.principals, tc.want.principals)
+			}
+			for i := range got.principals {
+				if got.principals[i] != tc.want.principals[i] {
+					t.Fatalf("parseSSHCA(%+v) principals = %v, want %v", tc.data, got.principals, tc.want.principals)
+				}
+			}
+			if len(got.extensions) != len(tc.want.extensions) {
+				t.Fatalf("parseSSHCA(%+v) extensions = %v, want %v", tc.data, got.extensions, tc.want.extensions)
+			}
+			for k, v := range tc.want.extensions {
+				if got.extensions[k] != v {
+					t.Fatalf("parseSSHCA(%+v) extensions[%q] = %q, want %q", tc.data, k, got.extensions[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestCertSignerForResetsOnKeyRotation(t *testing.T) {
+	a := newTestAgent(t)
+	src := KeySource{Mount: "kv"}
+	oldKey := newTestSigner(t)
+	ca := sshCA{mount: "ssh", role: "default"}
+
+	cs := a.certSignerFor(src, "alice", oldKey, ca)
+	cs.signer = oldKey
+	cs.expiresAt = time.Now().Add(time.Hour)
+
+	newKey := newTestSigner(t)
+	cs = a.certSignerFor(src, "alice", newKey, ca)
+	if cs.signer != nil || !cs.expiresAt.IsZero() {
+		t.Fatal("certSignerFor must drop the cached cert when the underlying private key rotates")
+	}
+	if cs.privateKey != newKey {
+		t.Fatal("certSignerFor must record the new private key")
+	}
+}
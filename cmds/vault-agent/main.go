@@ -15,32 +15,78 @@ import (
 	vaultagent "github.com/vanhtuan0409/vault-agent"
 )
 
+// keyPaths collects every -path flag, e.g.
+//
+//	-path kv/ssh_keys -path team=kv/team/ssh_keys
+type keyPaths []string
+
+func (p *keyPaths) String() string { return strings.Join(*p, ",") }
+
+func (p *keyPaths) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
 var (
 	socketPath string
 	vaultAddr  string
+	keyPath    keyPaths
+
+	authMethod string
+	authMount  string
 	vaultToken string
-	keyPath    string
+	tokenFile  string
+	roleID     string
+	secretID   string
+	secretFile string
+	authRole   string
+	jwt        string
+	jwtFile    string
+	cacheTTL   time.Duration
 )
 
 func main() {
 	flag.StringVar(&socketPath, "sock", "", "Socket path")
 	flag.StringVar(&vaultAddr, "vault", "", "Vault address")
+	flag.Var(&keyPath, "path", "Vault secret key path, e.g. kv/ssh_keys; repeat to aggregate multiple sources, optionally as label=mount/prefix")
+
+	flag.StringVar(&authMethod, "auth", "token", "Vault auth method: token, approle, kubernetes or oidc")
+	flag.StringVar(&authMount, "auth-mount", "", "Vault auth mount path (defaults to -auth)")
 	flag.StringVar(&vaultToken, "token", "", "Vault token")
-	flag.StringVar(&keyPath, "path", "kv/ssh_keys", "Vault secret key path")
+	flag.StringVar(&tokenFile, "token-file", "", "Path to a file containing a Vault token")
+	flag.StringVar(&roleID, "role-id", "", "AppRole role_id")
+	flag.StringVar(&secretID, "secret-id", "", "AppRole secret_id")
+	flag.StringVar(&secretFile, "secret-id-file", "", "Path to a file containing an AppRole secret_id")
+	flag.StringVar(&authRole, "role", "", "Kubernetes/OIDC auth role")
+	flag.StringVar(&jwt, "jwt", "", "Static JWT for OIDC auth")
+	flag.StringVar(&jwtFile, "jwt-file", "", "Path to a file containing a JWT for Kubernetes/OIDC auth")
+	flag.DurationVar(&cacheTTL, "cache-ttl", time.Minute, "How often to refresh the signer cache from Vault")
 	flag.Parse()
 	setDefaultConfig()
 	validateConfig()
 
+	auth, err := buildAuthenticator()
+	if err != nil {
+		log.Fatalln("Invalid auth configuration:", err)
+	}
+
 	ctx := context.Background()
-	c, err := vaultagent.GetVaultClient(ctx, vaultAddr, vaultToken)
+	c, err := vaultagent.GetVaultClient(ctx, vaultAddr, auth)
 	if err != nil {
 		log.Fatalln("Failed to create vault client:", err)
 	}
 
-	a, err := vaultagent.NewAgent(c, keyPath)
+	sources, err := buildKeySources()
+	if err != nil {
+		log.Fatalln("Invalid -path:", err)
+	}
+	a, err := vaultagent.NewAgent(c, sources...)
 	if err != nil {
 		log.Fatalln("Failed to create vault agent:", err)
 	}
+	a.SetAuthenticator(auth)
+	a.SetCacheTTL(cacheTTL)
+	go a.WatchCache(ctx)
 
 	if err := runAgent(ctx, a); err != nil {
 		log.Fatalln("Failed to run agent:", err)
@@ -57,13 +103,12 @@ func setDefaultConfig() {
 	if vaultAddr == "" {
 		vaultAddr = os.Getenv("VAULT_ADDR")
 	}
-	if vaultToken == "" {
+	if len(keyPath) == 0 {
+		keyPath = keyPaths{"kv/ssh_keys"}
+	}
+	if authMethod == "token" && vaultToken == "" && tokenFile == "" {
 		homeDir, _ := os.UserHomeDir()
-		tokenFile := filepath.Join(homeDir, ".vault-token")
-		tokenData, err := ioutil.ReadFile(tokenFile)
-		if err == nil {
-			vaultToken = strings.TrimSpace(string(tokenData))
-		}
+		tokenFile = filepath.Join(homeDir, ".vault-token")
 	}
 }
 
@@ -74,8 +119,54 @@ func validateConfig() {
 	if vaultAddr == "" {
 		log.Fatalln("Invalid vault address")
 	}
-	if vaultToken == "" {
-		log.Fatalln("Invalid vault token")
+}
+
+func buildKeySources() ([]vaultagent.KeySource, error) {
+	sources := make([]vaultagent.KeySource, 0, len(keyPath))
+	for _, spec := range keyPath {
+		src, err := vaultagent.ParseKeySource(spec)
+		if err != nil {
+			return nil, fmt.Errorf("`%s`: %w", spec, err)
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+func buildAuthenticator() (vaultagent.Authenticator, error) {
+	switch authMethod {
+	case "token":
+		if vaultToken != "" {
+			return vaultagent.TokenAuth{Token: vaultToken}, nil
+		}
+		if tokenFile != "" {
+			return vaultagent.FileTokenAuth{Path: tokenFile}, nil
+		}
+		return nil, fmt.Errorf("-token or -token-file is required for -auth=token")
+	case "approle":
+		if secretID == "" && secretFile != "" {
+			data, err := ioutil.ReadFile(secretFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read -secret-id-file: %w", err)
+			}
+			secretID = strings.TrimSpace(string(data))
+		}
+		if roleID == "" || secretID == "" {
+			return nil, fmt.Errorf("-role-id and -secret-id(-file) are required for -auth=approle")
+		}
+		return vaultagent.AppRoleAuth{MountPath: authMount, RoleID: roleID, SecretID: secretID}, nil
+	case "kubernetes":
+		if authRole == "" {
+			return nil, fmt.Errorf("-role is required for -auth=kubernetes")
+		}
+		return vaultagent.KubernetesAuth{MountPath: authMount, Role: authRole, JWTPath: jwtFile}, nil
+	case "oidc":
+		if authRole == "" {
+			return nil, fmt.Errorf("-role is required for -auth=oidc")
+		}
+		return vaultagent.OIDCAuth{MountPath: authMount, Role: authRole, JWT: jwt, JWTPath: jwtFile}, nil
+	default:
+		return nil, fmt.Errorf("unknown -auth method `%s`", authMethod)
 	}
 }
 
@@ -0,0 +1,35 @@
+package vaultagent
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ConfirmFunc is invoked before every Sign on a key whose Vault secret has
+// `confirm: true` set. Implementations are expected to prompt the user
+// (e.g. via pinentry) and return whether the operation is approved.
+type ConfirmFunc func(name string, key ssh.PublicKey) bool
+
+// SetConfirmFunc installs the prompt used to gate signing with keys that
+// require confirmation. Passing nil leaves no prompt installed, so keys
+// that require confirmation refuse to sign.
+func (a *Agent) SetConfirmFunc(fn ConfirmFunc) {
+	a.confirm = fn
+}
+
+// confirmingSigner wraps a signer and asks the agent's ConfirmFunc before
+// every signature, refusing to sign if the prompt rejects or none is set.
+type confirmingSigner struct {
+	ssh.Signer
+	a    *Agent
+	name string
+}
+
+func (c *confirmingSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	if c.a.confirm == nil || !c.a.confirm(c.name, c.Signer.PublicKey()) {
+		return nil, fmt.Errorf("signing with `%s` was not confirmed", c.name)
+	}
+	return c.Signer.Sign(rand, data)
+}
@@ -0,0 +1,82 @@
+package vaultagent
+
+import (
+	"io"
+	"log"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// CallingContext describes the peer asking the agent to list or sign keys.
+// PID/UID/GID are read from the local UNIX socket via SO_PEERCRED where the
+// platform supports it. Forwarded is set for any connection whose peer
+// credentials could not be read (a non-UNIX connection, or a platform
+// without SO_PEERCRED); it is not derived from SSH session information.
+type CallingContext struct {
+	PID       int32
+	UID       uint32
+	GID       uint32
+	Forwarded bool
+}
+
+// SignPolicy is evaluated on every Sign before the underlying key is used.
+// Returning a non-nil error refuses the signature. Policies can restrict
+// which processes may use which keys, require confirmation only for
+// forwarded connections, or log an audit trail.
+type SignPolicy func(ctx CallingContext, key ssh.PublicKey, data []byte) error
+
+// SetSignPolicy installs the policy evaluated on every Sign. Passing nil
+// removes any restriction beyond what individual keys already enforce.
+func (a *Agent) SetSignPolicy(p SignPolicy) {
+	a.policy = p
+}
+
+func callingContextForConn(c net.Conn) CallingContext {
+	ctx := CallingContext{Forwarded: true}
+	if uc, ok := c.(*net.UnixConn); ok {
+		if pid, uid, gid, err := peerCredFor(uc); err == nil {
+			ctx = CallingContext{PID: pid, UID: uid, GID: gid}
+		}
+	}
+	return ctx
+}
+
+// connAgent binds a CallingContext to every request made over a single
+// connection so SignPolicy can make per-caller decisions.
+type connAgent struct {
+	*Agent
+	ctx CallingContext
+}
+
+func (c *connAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	if err := c.checkPolicy(key, data); err != nil {
+		return nil, err
+	}
+	return c.Agent.Sign(key, data)
+}
+
+func (c *connAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	if err := c.checkPolicy(key, data); err != nil {
+		return nil, err
+	}
+	return c.Agent.SignWithFlags(key, data, flags)
+}
+
+func (c *connAgent) checkPolicy(key ssh.PublicKey, data []byte) error {
+	if c.Agent.policy == nil {
+		return nil
+	}
+	return c.Agent.policy(c.ctx, key, data)
+}
+
+func (a *Agent) ServeConn(c net.Conn) error {
+	defer c.Close()
+	ca := &connAgent{Agent: a, ctx: callingContextForConn(c)}
+	if err := agent.ServeAgent(ca, c); err != io.EOF {
+		log.Println("Agent handle connection failed:", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package vaultagent
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCallingContextForConnNonUnix(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx := callingContextForConn(server)
+	if !ctx.Forwarded {
+		t.Fatal("a non-UNIX connection should be reported as forwarded")
+	}
+	if ctx.PID != 0 || ctx.UID != 0 || ctx.GID != 0 {
+		t.Fatalf("a non-UNIX connection should carry zero-value peer credentials, got %+v", ctx)
+	}
+}
+
+func TestCheckPolicyNilAllowsByDefault(t *testing.T) {
+	a := newTestAgent(t)
+	ca := &connAgent{Agent: a, ctx: CallingContext{PID: 1}}
+
+	key := newTestPublicKey(t)
+	if err := ca.checkPolicy(key, []byte("data")); err != nil {
+		t.Fatalf("checkPolicy with no SignPolicy installed should allow, got %v", err)
+	}
+}
+
+func TestCheckPolicyInvokesPolicyWithContext(t *testing.T) {
+	a := newTestAgent(t)
+	want := CallingContext{PID: 42, UID: 1000, GID: 1000}
+	key := newTestPublicKey(t)
+	data := []byte("sign me")
+	errDenied := errors.New("denied")
+
+	var gotCtx CallingContext
+	var gotKey []byte
+	var gotData []byte
+	a.SetSignPolicy(func(ctx CallingContext, k ssh.PublicKey, d []byte) error {
+		gotCtx, gotKey, gotData = ctx, k.Marshal(), d
+		return errDenied
+	})
+
+	ca := &connAgent{Agent: a, ctx: want}
+	if err := ca.checkPolicy(key, data); !errors.Is(err, errDenied) {
+		t.Fatalf("checkPolicy should surface the policy's error, got %v", err)
+	}
+	if gotCtx != want {
+		t.Fatalf("policy received ctx %+v, want %+v", gotCtx, want)
+	}
+	if !bytes.Equal(gotKey, key.Marshal()) {
+		t.Fatal("policy received the wrong key")
+	}
+	if !bytes.Equal(gotData, data) {
+		t.Fatal("policy received the wrong data")
+	}
+}
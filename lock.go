@@ -0,0 +1,113 @@
+package vaultagent
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrLocked is returned by Sign and Signers while the agent is locked;
+// List instead reports an empty key list. This matches the ssh-agent
+// protocol semantics implemented by golang.org/x/crypto/ssh/agent.
+var ErrLocked = errors.New("agent is locked")
+
+const extensionReload = "vault-agent-reload@vanhtuan0409.github.io"
+
+var supportedExtensions = []string{extensionReload}
+
+func (a *Agent) Lock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.locked {
+		return errors.New("agent is already locked")
+	}
+	a.locked = true
+	a.passphrase = append([]byte(nil), passphrase...)
+	return nil
+}
+
+func (a *Agent) Unlock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.locked {
+		return errors.New("agent is not locked")
+	}
+	if subtle.ConstantTimeCompare(a.passphrase, passphrase) != 1 {
+		return errors.New("incorrect passphrase")
+	}
+	a.locked = false
+	a.passphrase = nil
+	return nil
+}
+
+func (a *Agent) isLocked() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.locked
+}
+
+// Remove hides key for the lifetime of the process. Vault itself is never
+// touched, so the key reappears on the next restart.
+func (a *Agent) Remove(key ssh.PublicKey) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.removed[string(key.Marshal())] = true
+	return nil
+}
+
+// RemoveAll hides every key for the lifetime of the process.
+func (a *Agent) RemoveAll() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.removedAll = true
+	a.removed = map[string]bool{}
+	return nil
+}
+
+func (a *Agent) isRemoved(key ssh.PublicKey) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.removedAll {
+		return true
+	}
+	return a.removed[string(key.Marshal())]
+}
+
+// SignWithFlags implements agent.ExtendedAgent. Signature flags (e.g.
+// rsa-sha2-256) are currently ignored; Sign is used for every key type.
+func (a *Agent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	return a.Sign(key, data)
+}
+
+// Extension implements agent.ExtendedAgent, dispatching the subset of
+// ssh-agent extension messages vault-agent understands:
+//   - "query" reports the extensions supported by this agent.
+//   - "session-bind@openssh.com" is accepted and ignored; vault-agent does
+//     not track forwarded session bindings.
+//   - the vault-agent-reload extension makes the next List/Sign re-list
+//     keys from Vault; entries whose KV v2 updated_time is unchanged keep
+//     their previously loaded signer.
+func (a *Agent) Extension(extensionType string, contents []byte) ([]byte, error) {
+	switch extensionType {
+	case "query":
+		return ssh.Marshal(struct {
+			Extensions []string
+		}{Extensions: supportedExtensions}), nil
+	case "session-bind@openssh.com":
+		return nil, nil
+	case extensionReload:
+		return nil, a.reload()
+	default:
+		return nil, agent.ErrExtensionUnsupported
+	}
+}
+
+// reload drops the served signer set so the next List/Sign runs Refresh,
+// which re-lists keys from Vault and re-fetches only the entries whose KV
+// v2 updated_time changed.
+func (a *Agent) reload() error {
+	a.cache.invalidateAll()
+	return nil
+}
@@ -0,0 +1,93 @@
+package vaultagent
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestAgent(t *testing.T) *Agent {
+	t.Helper()
+	a, err := NewAgent(nil, KeySource{Mount: "kv"})
+	if err != nil {
+		t.Fatalf("NewAgent: %v", err)
+	}
+	return a
+}
+
+func newTestPublicKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("ssh.NewPublicKey: %v", err)
+	}
+	return sshPub
+}
+
+func TestLockUnlock(t *testing.T) {
+	a := newTestAgent(t)
+
+	if a.isLocked() {
+		t.Fatal("new agent should not start locked")
+	}
+
+	if err := a.Lock([]byte("hunter2")); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if !a.isLocked() {
+		t.Fatal("agent should be locked after Lock")
+	}
+	if err := a.Lock([]byte("hunter2")); err == nil {
+		t.Fatal("Lock while already locked should error")
+	}
+
+	if err := a.Unlock([]byte("wrong")); err == nil {
+		t.Fatal("Unlock with wrong passphrase should error")
+	}
+	if !a.isLocked() {
+		t.Fatal("a failed Unlock must not unlock the agent")
+	}
+
+	if err := a.Unlock([]byte("hunter2")); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if a.isLocked() {
+		t.Fatal("agent should be unlocked after a correct Unlock")
+	}
+	if err := a.Unlock([]byte("hunter2")); err == nil {
+		t.Fatal("Unlock while already unlocked should error")
+	}
+}
+
+func TestRemoveAndRemoveAll(t *testing.T) {
+	a := newTestAgent(t)
+	key1 := newTestPublicKey(t)
+	key2 := newTestPublicKey(t)
+
+	if a.isRemoved(key1) {
+		t.Fatal("key should not start removed")
+	}
+
+	if err := a.Remove(key1); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if !a.isRemoved(key1) {
+		t.Fatal("key1 should be removed after Remove")
+	}
+	if a.isRemoved(key2) {
+		t.Fatal("Remove must not affect other keys")
+	}
+
+	if err := a.RemoveAll(); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if !a.isRemoved(key1) || !a.isRemoved(key2) {
+		t.Fatal("RemoveAll should hide every key")
+	}
+}
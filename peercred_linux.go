@@ -0,0 +1,31 @@
+//go:build linux
+
+package vaultagent
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredFor reads the connecting process's PID/UID/GID off the UNIX
+// socket via SO_PEERCRED.
+func peerCredFor(c *net.UnixConn) (pid int32, uid uint32, gid uint32, err error) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var ucred *syscall.Ucred
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, sockErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if sockErr != nil {
+		return 0, 0, 0, sockErr
+	}
+
+	return ucred.Pid, ucred.Uid, ucred.Gid, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package vaultagent
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCredFor is unimplemented outside Linux; callers fall back to a
+// CallingContext with no peer credentials and Forwarded set.
+func peerCredFor(c *net.UnixConn) (pid int32, uid uint32, gid uint32, err error) {
+	return 0, 0, 0, errors.New("peer credentials unsupported on this platform")
+}
@@ -0,0 +1,104 @@
+package vaultagent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+)
+
+// KeySource describes one Vault KV v2 mount (and optional sub-tree within
+// it) that the agent should pull signers from. Label is cosmetic: it is
+// surfaced in List()'s key comments so a client juggling several mounts
+// can tell entries apart.
+type KeySource struct {
+	Mount  string
+	Prefix string
+	Label  string
+}
+
+// ParseKeySource accepts the historical "mount/prefix" CLI form, optionally
+// prefixed with "label=", e.g. "prod=kv/ssh_keys/prod".
+func ParseKeySource(spec string) (KeySource, error) {
+	label := ""
+	if idx := strings.Index(spec, "="); idx >= 0 {
+		label, spec = spec[:idx], spec[idx+1:]
+	}
+
+	parts := strings.SplitN(strings.Trim(spec, "/"), "/", 2)
+	if parts[0] == "" {
+		return KeySource{}, errors.New("invalid secret path")
+	}
+
+	ks := KeySource{Mount: parts[0], Label: label}
+	if len(parts) == 2 {
+		ks.Prefix = parts[1]
+	}
+	return ks, nil
+}
+
+func (ks KeySource) comment(name string) string {
+	label := ks.Label
+	if label == "" {
+		label = ks.Mount
+	}
+	return "source:" + label + " path:" + name
+}
+
+func (ks KeySource) metadataPath(dir string) string {
+	return strings.Join([]string{ks.Mount, "metadata", dir}, "/")
+}
+
+// entryKey returns a stable identity for one key within a source, used to
+// key the certSigner registry and the cache's "known" set across Refresh
+// calls. It is independent of Label, since relabeling a source shouldn't
+// reset state tied to the same underlying Vault path.
+func entryKey(src KeySource, name string) string {
+	return src.Mount + "\x00" + name
+}
+
+// walk depth-first lists every leaf secret under src, recursing into KV v2
+// metadata directories (entries whose name ends in "/") similar to how
+// kr/fs.Walker traverses a remote filesystem tree.
+func (a *Agent) walk(ctx context.Context, src KeySource) ([]string, error) {
+	return a.walkDir(ctx, src, src.Prefix)
+}
+
+func (a *Agent) walkDir(ctx context.Context, src KeySource, dir string) ([]string, error) {
+	path := src.metadataPath(dir)
+	secret, err := a.c.Logical().ListWithContext(ctx, path)
+	if isPermissionDenied(err) && a.reauthenticate() == nil {
+		secret, err = a.c.Logical().ListWithContext(ctx, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, nil
+	}
+	items, ok := secret.Data["keys"].([]interface{})
+	if !ok {
+		return nil, errNoKeyList
+	}
+
+	var names []string
+	for _, item := range items {
+		entry, ok := item.(string)
+		if !ok {
+			continue
+		}
+		full := strings.Trim(dir+"/"+strings.TrimSuffix(entry, "/"), "/")
+
+		if !strings.HasSuffix(entry, "/") {
+			names = append(names, full)
+			continue
+		}
+		children, err := a.walkDir(ctx, src, full)
+		if err != nil {
+			log.Printf("Unable to list `%s/%s`: %v\n", src.Mount, full, err)
+			continue
+		}
+		names = append(names, children...)
+	}
+	return names, nil
+}
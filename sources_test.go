@@ -0,0 +1,58 @@
+package vaultagent
+
+import "testing"
+
+func TestParseKeySource(t *testing.T) {
+	cases := []struct {
+		name string
+		spec string
+		want KeySource
+	}{
+		{
+			name: "mount only",
+			spec: "kv",
+			want: KeySource{Mount: "kv"},
+		},
+		{
+			name: "mount and prefix",
+			spec: "kv/ssh_keys",
+			want: KeySource{Mount: "kv", Prefix: "ssh_keys"},
+		},
+		{
+			name: "nested prefix",
+			spec: "kv/team/ssh_keys",
+			want: KeySource{Mount: "kv", Prefix: "team/ssh_keys"},
+		},
+		{
+			name: "labeled",
+			spec: "prod=kv/ssh_keys/prod",
+			want: KeySource{Mount: "kv", Prefix: "ssh_keys/prod", Label: "prod"},
+		},
+		{
+			name: "leading and trailing slashes trimmed",
+			spec: "/kv/ssh_keys/",
+			want: KeySource{Mount: "kv", Prefix: "ssh_keys"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseKeySource(tc.spec)
+			if err != nil {
+				t.Fatalf("ParseKeySource(%q) returned error: %v", tc.spec, err)
+			}
+			if got != tc.want {
+				t.Fatalf("ParseKeySource(%q) = %+v, want %+v", tc.spec, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseKeySourceInvalid(t *testing.T) {
+	cases := []string{"", "/", "label="}
+	for _, spec := range cases {
+		if _, err := ParseKeySource(spec); err == nil {
+			t.Errorf("ParseKeySource(%q) expected an error, got nil", spec)
+		}
+	}
+}
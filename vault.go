@@ -2,17 +2,80 @@ package vaultagent
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 
 	vault "github.com/hashicorp/vault/api"
 )
 
-func GetVaultClient(ctx context.Context, addr, token string) (*vault.Client, error) {
+// GetVaultClient builds a Vault client for addr and logs in with auth,
+// starting a background renewer so the agent keeps working past the
+// initial token's lease without the caller having to do anything.
+func GetVaultClient(ctx context.Context, addr string, auth Authenticator) (*vault.Client, error) {
 	cfg := vault.DefaultConfig()
 	cfg.Address = addr
 	client, err := vault.NewClient(cfg)
 	if err != nil {
 		return nil, err
 	}
-	client.SetToken(token)
+	if err := authenticate(ctx, client, auth); err != nil {
+		return nil, err
+	}
 	return client, nil
 }
+
+func authenticate(ctx context.Context, client *vault.Client, auth Authenticator) error {
+	secret, err := auth.Login(ctx, client)
+	if err != nil {
+		return fmt.Errorf("unable to authenticate to vault: %w", err)
+	}
+	token, err := secret.TokenID()
+	if err != nil {
+		return fmt.Errorf("unable to read vault token: %w", err)
+	}
+	client.SetToken(token)
+
+	if secret.Auth != nil && secret.Auth.Renewable {
+		go watchLifetime(client, auth, secret)
+	}
+	return nil
+}
+
+// watchLifetime keeps client's token alive for as long as the process
+// runs, re-authenticating from scratch if Vault ever lets the lease die
+// out from under the watcher (e.g. the secret engine revoked it).
+func watchLifetime(client *vault.Client, auth Authenticator, secret *vault.Secret) {
+	watcher, err := client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{Secret: secret})
+	if err != nil {
+		log.Println("Unable to start vault token renewer:", err)
+		return
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case err := <-watcher.DoneCh():
+			if err != nil {
+				log.Println("Vault token renewal stopped, re-authenticating:", err)
+			}
+			if err := authenticate(context.Background(), client, auth); err != nil {
+				log.Println("Unable to re-authenticate to vault:", err)
+			}
+			return
+		case <-watcher.RenewCh():
+			log.Println("Vault token renewed")
+		}
+	}
+}
+
+// isPermissionDenied reports whether err is Vault's 403 response, the
+// signal that the agent's token has expired or been revoked.
+func isPermissionDenied(err error) bool {
+	var respErr *vault.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode == 403
+	}
+	return false
+}